@@ -32,6 +32,10 @@ type Config struct {
 	// Numbers of layers to wait before determining beacon values from ballots when the node didn't participate
 	// in previous epoch.
 	BeaconSyncWeightUnits int `mapstructure:"beacon-sync-weight-units"`
+	// Maximum number of chunks a peer may send us in response to a single
+	// BeaconBallotsByEpoch/BeaconProposalsByEpoch request, so a misbehaving or
+	// unbounded peer can't force us to buffer an unlimited response.
+	MaxResponseChunks int `mapstructure:"beacon-max-response-chunks"`
 }
 
 // DefaultConfig returns the default configuration for the beacon.
@@ -48,6 +52,7 @@ func DefaultConfig() Config {
 		Theta:                    big.NewRat(1, 4),
 		VotesLimit:               100, // TODO: around 100, find the calculation in the forum
 		BeaconSyncWeightUnits:    800, // at least 1 cluster of 800 weight units
+		MaxResponseChunks:        100,
 	}
 }
 
@@ -65,6 +70,7 @@ func UnitTestConfig() Config {
 		Theta:                    big.NewRat(1, 25000),
 		VotesLimit:               100,
 		BeaconSyncWeightUnits:    2,
+		MaxResponseChunks:        10,
 	}
 }
 
@@ -82,5 +88,6 @@ func NodeSimUnitTestConfig() Config {
 		Theta:                    big.NewRat(1, 25000),
 		VotesLimit:               100,
 		BeaconSyncWeightUnits:    10,
+		MaxResponseChunks:        10,
 	}
 }
@@ -0,0 +1,361 @@
+package beacon
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"golang.org/x/time/rate"
+
+	"github.com/spacemeshos/go-spacemesh/codec"
+	"github.com/spacemeshos/go-spacemesh/common/types"
+	"github.com/spacemeshos/go-spacemesh/log"
+	"github.com/spacemeshos/go-spacemesh/p2p"
+)
+
+const (
+	// BeaconBallotsByEpochProtocol is the req/resp protocol a node uses to
+	// pull the ballots it's missing for a past epoch from a peer, so it can
+	// reconstruct that epoch's beacon instead of only waiting for gossip.
+	BeaconBallotsByEpochProtocol = "/beacon/ballots/1"
+
+	// BeaconProposalsByEpochProtocol is the req/resp protocol a node uses to
+	// pull the proposals it's missing for a past epoch from a peer.
+	BeaconProposalsByEpochProtocol = "/beacon/proposals/1"
+)
+
+// ballotsByEpochRequest asks a peer for up to count ballots for epoch whose
+// cumulative weight is at least startWeight, so a syncing node can resume a
+// partially-satisfied request instead of re-fetching ballots it already has.
+type ballotsByEpochRequest struct {
+	Epoch       types.EpochID
+	StartWeight uint64
+	Count       uint32
+}
+
+// proposalsByEpochRequest asks a peer for the proposals it holds for epoch.
+type proposalsByEpochRequest struct {
+	Epoch types.EpochID
+}
+
+// chunkFetcher is the subset of a p2p request/response client that SyncEpoch
+// needs: send a request to a peer and get back one or more length-prefixed
+// response chunks. maxChunks bounds how many chunks the fetcher will read off
+// the wire before giving up on the response, so a misbehaving or unbounded
+// peer can't force the caller to buffer an unlimited response.
+type chunkFetcher interface {
+	Request(ctx context.Context, peer p2p.Peer, req []byte, protocol string, maxChunks int) (resp [][]byte, err error)
+}
+
+// ballotValidator is the subset of eligibility checking SyncEpoch needs, so
+// ballots pulled from a peer are held to the same bar as ones proposals
+// receives over gossip (see proposals.eligibilityValidator) before they're
+// allowed to contribute weight toward an epoch's beacon.
+type ballotValidator interface {
+	CheckEligibility(context.Context, *types.Ballot) (bool, error)
+}
+
+// epochMesh is the subset of mesh/ballot storage SyncEpoch needs to assemble
+// a beacon from synced ballots and proposals, and to serve the same data
+// back out to peers syncing from us.
+type epochMesh interface {
+	AddBallot(*types.Ballot) error
+	AddProposal(*types.Proposal) error
+	WeightForEpoch(types.EpochID) (uint64, error)
+
+	// BallotsForEpoch returns up to count ballots this node holds for epoch
+	// whose cumulative weight is at least startWeight, in the same order a
+	// peer would need them to resume a partially-satisfied request. It backs
+	// the BeaconBallotsByEpoch responder.
+	BallotsForEpoch(epoch types.EpochID, startWeight uint64, count uint32) ([]*types.Ballot, error)
+
+	// ProposalsForEpoch returns the proposals this node holds for epoch. It
+	// backs the BeaconProposalsByEpoch responder.
+	ProposalsForEpoch(epoch types.EpochID) ([]*types.Proposal, error)
+}
+
+// streamHandler answers a single request from peer on a req/resp protocol,
+// returning the response as one or more length-prefixed chunks.
+type streamHandler func(ctx context.Context, peer p2p.Peer, req []byte) ([][]byte, error)
+
+// handlerHost is the subset of the p2p host the responder side needs:
+// registering a handler that answers requests from peers on a protocol.
+type handlerHost interface {
+	RegisterBytesMsgHandler(protocol string, handler streamHandler)
+}
+
+// Syncer pulls the ballots/proposals a lagging node needs to reconstruct a
+// past epoch's beacon, rather than only passively counting weight units as
+// gossip happens to deliver them. Nothing in this package creates a Syncer
+// or calls SyncEpoch; whoever builds one with NewSyncer decides when to run it.
+type Syncer struct {
+	cfg       Config
+	fetcher   chunkFetcher
+	mesh      epochMesh
+	validator ballotValidator
+	peers     func() []p2p.Peer
+
+	// computeBeacon is the caller-supplied weak-coin/vote tally -
+	// SyncEpoch's job ends at assembling enough weight for it to trust the
+	// epoch's ballots, not at recomputing the beacon itself.
+	computeBeacon func(types.EpochID) (types.Beacon, error)
+
+	// limiter is one limiter shared across all peers: SyncEpoch waits on it
+	// before each peer's ballots/proposals requests, so a busy sync loop
+	// can't hammer peers with requests.
+	limiter *rate.Limiter
+
+	// serveLimiters bounds how often any single peer may hit our
+	// BeaconBallotsByEpoch/BeaconProposalsByEpoch handlers, so one chatty
+	// peer can't starve service to the rest of our peers. This is separate
+	// from limiter, which only throttles requests we send out.
+	serveLimiters *peerLimiters
+}
+
+// peerLimiters hands out a per-peer rate.Limiter, lazily creating one the
+// first time a given peer is seen.
+type peerLimiters struct {
+	mu         sync.Mutex
+	limiters   map[p2p.Peer]*rate.Limiter
+	newLimiter func() *rate.Limiter
+}
+
+func newPeerLimiters(newLimiter func() *rate.Limiter) *peerLimiters {
+	return &peerLimiters{
+		limiters:   make(map[p2p.Peer]*rate.Limiter),
+		newLimiter: newLimiter,
+	}
+}
+
+func (p *peerLimiters) get(peer p2p.Peer) *rate.Limiter {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	l, ok := p.limiters[peer]
+	if !ok {
+		l = p.newLimiter()
+		p.limiters[peer] = l
+	}
+	return l
+}
+
+// NewSyncer builds a Syncer. peers returns the current peer set to try
+// requests against, in order, until enough weight has been assembled.
+// validator is consulted for every ballot (and every proposal's ballot) a
+// peer sends us, the same eligibility check gossip-received ballots are held
+// to, so a synced epoch can't be skewed by a peer handing back fabricated
+// ones. computeBeacon is the caller's weak-coin tally, invoked once
+// enough ballot weight has been synced for epoch.
+func NewSyncer(cfg Config, fetcher chunkFetcher, mesh epochMesh, validator ballotValidator, peers func() []p2p.Peer, computeBeacon func(types.EpochID) (types.Beacon, error)) *Syncer {
+	return &Syncer{
+		cfg:           cfg,
+		fetcher:       fetcher,
+		mesh:          mesh,
+		validator:     validator,
+		peers:         peers,
+		computeBeacon: computeBeacon,
+		limiter:       rate.NewLimiter(rate.Limit(1), 1),
+		serveLimiters: newPeerLimiters(func() *rate.Limiter { return rate.NewLimiter(rate.Limit(1), 1) }),
+	}
+}
+
+// RegisterHandlers wires up the responder side of BeaconBallotsByEpoch and
+// BeaconProposalsByEpoch against host, so peers can sync an epoch from us
+// the same way we sync from them.
+func (s *Syncer) RegisterHandlers(host handlerHost) {
+	host.RegisterBytesMsgHandler(BeaconBallotsByEpochProtocol, s.handleBallotsByEpoch)
+	host.RegisterBytesMsgHandler(BeaconProposalsByEpochProtocol, s.handleProposalsByEpoch)
+}
+
+// SyncEpoch actively pulls ballots (and their proposals) for epoch from
+// peers until BeaconSyncWeightUnits worth of validated ballots have been
+// assembled, or ctx is done. It returns the beacon computed from those
+// ballots.
+func (s *Syncer) SyncEpoch(ctx context.Context, epoch types.EpochID) (types.Beacon, error) {
+
+	var assembled uint64
+
+	for _, peer := range s.peers() {
+		if assembled >= uint64(s.cfg.BeaconSyncWeightUnits) {
+			break
+		}
+
+		if err := s.limiter.Wait(ctx); err != nil {
+			return types.EmptyBeacon, err
+		}
+
+		weight, err := s.syncBallotsFromPeer(ctx, peer, epoch, assembled)
+		if err != nil {
+			log.Info("beacon sync: ballots request to %s failed: %v", peer, err)
+			continue
+		}
+
+		if err := s.syncProposalsFromPeer(ctx, peer, epoch); err != nil {
+			log.Info("beacon sync: proposals request to %s failed: %v", peer, err)
+		}
+
+		assembled += weight
+	}
+
+	if assembled < uint64(s.cfg.BeaconSyncWeightUnits) {
+		return types.EmptyBeacon, fmt.Errorf("beacon sync: only assembled %d/%d weight units for epoch %v",
+			assembled, s.cfg.BeaconSyncWeightUnits, epoch)
+	}
+
+	return s.computeBeacon(epoch)
+}
+
+// syncBallotsFromPeer issues a BeaconBallotsByEpoch request against peer,
+// starting from startWeight, and stores the ballots it gets back. It returns
+// the additional weight those ballots represent.
+func (s *Syncer) syncBallotsFromPeer(ctx context.Context, peer p2p.Peer, epoch types.EpochID, startWeight uint64) (uint64, error) {
+	req, err := codec.Encode(&ballotsByEpochRequest{
+		Epoch:       epoch,
+		StartWeight: startWeight,
+		Count:       uint32(s.cfg.VotesLimit),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	chunks, err := s.fetcher.Request(ctx, peer, req, BeaconBallotsByEpochProtocol, s.cfg.MaxResponseChunks)
+	if err != nil {
+		return 0, err
+	}
+
+	before, err := s.mesh.WeightForEpoch(epoch)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, chunk := range chunks {
+		var ballot types.Ballot
+		if err := codec.Decode(chunk, &ballot); err != nil {
+			return 0, fmt.Errorf("beacon sync: bad ballot chunk from %s: %w", peer, err)
+		}
+
+		eligible, err := s.validator.CheckEligibility(ctx, &ballot)
+		if err != nil {
+			return 0, fmt.Errorf("beacon sync: eligibility check failed for ballot from %s: %w", peer, err)
+		}
+		if !eligible {
+			return 0, fmt.Errorf("beacon sync: peer %s sent an ineligible ballot", peer)
+		}
+
+		if err := s.mesh.AddBallot(&ballot); err != nil {
+			return 0, err
+		}
+	}
+
+	after, err := s.mesh.WeightForEpoch(epoch)
+	if err != nil {
+		return 0, err
+	}
+
+	return after - before, nil
+}
+
+// syncProposalsFromPeer issues a BeaconProposalsByEpoch request against peer
+// and stores the proposals it gets back.
+func (s *Syncer) syncProposalsFromPeer(ctx context.Context, peer p2p.Peer, epoch types.EpochID) error {
+	req, err := codec.Encode(&proposalsByEpochRequest{Epoch: epoch})
+	if err != nil {
+		return err
+	}
+
+	chunks, err := s.fetcher.Request(ctx, peer, req, BeaconProposalsByEpochProtocol, s.cfg.MaxResponseChunks)
+	if err != nil {
+		return err
+	}
+
+	for _, chunk := range chunks {
+		var proposal types.Proposal
+		if err := codec.Decode(chunk, &proposal); err != nil {
+			return fmt.Errorf("beacon sync: bad proposal chunk from %s: %w", peer, err)
+		}
+
+		eligible, err := s.validator.CheckEligibility(ctx, &proposal.Ballot)
+		if err != nil {
+			return fmt.Errorf("beacon sync: eligibility check failed for proposal from %s: %w", peer, err)
+		}
+		if !eligible {
+			return fmt.Errorf("beacon sync: peer %s sent a proposal with an ineligible ballot", peer)
+		}
+
+		if err := s.mesh.AddProposal(&proposal); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// handleBallotsByEpoch answers a BeaconBallotsByEpoch request from peer: it
+// looks up the ballots we hold for the requested epoch starting from the
+// requested weight, and returns up to req.Count of them (capped at
+// cfg.MaxResponseChunks), each ballot as its own response chunk.
+func (s *Syncer) handleBallotsByEpoch(ctx context.Context, peer p2p.Peer, reqBytes []byte) ([][]byte, error) {
+	if err := s.serveLimiters.get(peer).Wait(ctx); err != nil {
+		return nil, err
+	}
+
+	var req ballotsByEpochRequest
+	if err := codec.Decode(reqBytes, &req); err != nil {
+		return nil, fmt.Errorf("beacon sync: bad ballots request from %s: %w", peer, err)
+	}
+
+	count := req.Count
+	if count == 0 || count > uint32(s.cfg.MaxResponseChunks) {
+		count = uint32(s.cfg.MaxResponseChunks)
+	}
+
+	ballots, err := s.mesh.BallotsForEpoch(req.Epoch, req.StartWeight, count)
+	if err != nil {
+		return nil, err
+	}
+
+	chunks := make([][]byte, 0, len(ballots))
+	for _, ballot := range ballots {
+		chunk, err := codec.Encode(ballot)
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks, nil
+}
+
+// handleProposalsByEpoch answers a BeaconProposalsByEpoch request from peer
+// with the proposals we hold for the requested epoch, one per response
+// chunk and capped at cfg.MaxResponseChunks.
+func (s *Syncer) handleProposalsByEpoch(ctx context.Context, peer p2p.Peer, reqBytes []byte) ([][]byte, error) {
+	if err := s.serveLimiters.get(peer).Wait(ctx); err != nil {
+		return nil, err
+	}
+
+	var req proposalsByEpochRequest
+	if err := codec.Decode(reqBytes, &req); err != nil {
+		return nil, fmt.Errorf("beacon sync: bad proposals request from %s: %w", peer, err)
+	}
+
+	proposals, err := s.mesh.ProposalsForEpoch(req.Epoch)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(proposals) > s.cfg.MaxResponseChunks {
+		proposals = proposals[:s.cfg.MaxResponseChunks]
+	}
+
+	chunks := make([][]byte, 0, len(proposals))
+	for _, proposal := range proposals {
+		chunk, err := codec.Encode(proposal)
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks, nil
+}
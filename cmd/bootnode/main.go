@@ -0,0 +1,93 @@
+// Command bootnode runs a standalone p2p2 discovery listener: just the
+// Kademlia ping/pong/findnode/neighbors protocol, with no swarm, sessions or
+// higher-level protocols attached. It lets operators stand up bootstrap
+// nodes for other p2p2 nodes to seed their peer discovery table from,
+// without running the full stack.
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/UnrulyOS/go-unruly/crypto"
+	"github.com/UnrulyOS/go-unruly/log"
+	"github.com/UnrulyOS/go-unruly/p2p2/discover"
+)
+
+func main() {
+	var (
+		listenAddr = flag.String("addr", ":7513", "UDP address to listen for discovery traffic on")
+		nodeKey    = flag.String("nodekey", "", "path to a file holding the node's private key")
+		nodeKeyHex = flag.String("nodekeyhex", "", "the node's private key as a hex string")
+		genKey     = flag.String("genkey", "", "generate a new node key and save it to this file, then exit")
+	)
+	flag.Parse()
+
+	if *genKey != "" {
+		if err := generateNodeKey(*genKey); err != nil {
+			log.Error("failed to generate node key: %v", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	priv, err := loadNodeKey(*nodeKey, *nodeKeyHex)
+	if err != nil {
+		log.Error("failed to load node key: %v", err)
+		os.Exit(1)
+	}
+
+	id := priv.GetPublicKey().String()
+
+	d, err := discover.New(id, *listenAddr, func(n discover.NodeInfo) {
+		log.Info("discovered peer %s at %s", n.Id, n.Ip)
+	})
+	if err != nil {
+		log.Error("failed to start discovery listener: %v", err)
+		os.Exit(1)
+	}
+	defer d.Close()
+
+	log.Info("bootnode %s listening for discovery traffic on %s", id, *listenAddr)
+
+	select {}
+}
+
+// generateNodeKey creates a fresh node identity key and persists it to path
+// as a hex string, so it can be reused across restarts with -nodekey.
+func generateNodeKey(path string) error {
+	priv, _, err := crypto.GenerateKeyPair()
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, []byte(hex.EncodeToString(priv.Bytes())), 0600)
+}
+
+func loadNodeKey(path string, hexKey string) (crypto.PrivateKey, error) {
+	switch {
+	case hexKey != "":
+		data, err := hex.DecodeString(hexKey)
+		if err != nil {
+			return nil, fmt.Errorf("bad -nodekeyhex: %w", err)
+		}
+		return crypto.NewPrivateKey(data)
+
+	case path != "":
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("bad -nodekey: %w", err)
+		}
+		raw, err := hex.DecodeString(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("bad -nodekey contents: %w", err)
+		}
+		return crypto.NewPrivateKey(raw)
+
+	default:
+		return nil, fmt.Errorf("one of -nodekey, -nodekeyhex or -genkey is required")
+	}
+}
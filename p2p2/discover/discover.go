@@ -0,0 +1,87 @@
+package discover
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+
+	"github.com/UnrulyOS/go-unruly/log"
+)
+
+// Discovery bootstraps and grows a Table by speaking the UDP discovery
+// protocol against a configurable list of bootnodes, and serves it back out
+// to callers (Swarm.Bootstrap / Swarm.ConnectToRandomPeers) via RandomPeers.
+type Discovery struct {
+	table    *Table
+	protocol *Protocol
+}
+
+// New starts a Discovery listening on udpListenAddr for localId, calling
+// onDiscovered whenever a previously unknown peer is learned about.
+func New(localId string, udpListenAddr string, onDiscovered func(NodeInfo)) (*Discovery, error) {
+	table := NewTable(localId)
+
+	protocol, err := Listen(localId, udpListenAddr, table, onDiscovered)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Discovery{table: table, protocol: protocol}, nil
+}
+
+func (d *Discovery) Close() {
+	d.protocol.Close()
+}
+
+// Bootstrap pings every bootnode to seed the table, then runs an iterative
+// lookup for our own id to fill out buckets with whatever peers the
+// bootnodes (and the peers they introduce us to) already know about.
+func (d *Discovery) Bootstrap(ctx context.Context, localId string, bootnodes []NodeInfo) error {
+	if len(bootnodes) == 0 {
+		return fmt.Errorf("discover: no bootnodes configured")
+	}
+
+	seeded := 0
+	for _, b := range bootnodes {
+		if err := d.protocol.Ping(ctx, b.Ip); err != nil {
+			log.Warning("discover: bootnode %s unreachable: %v", b.Ip, err)
+			continue
+		}
+		d.table.Add(b)
+		seeded++
+	}
+
+	if seeded == 0 {
+		return fmt.Errorf("discover: none of %d bootnodes responded", len(bootnodes))
+	}
+
+	d.protocol.Lookup(ctx, localId)
+
+	return nil
+}
+
+// RandomPeers returns up to n peers currently known to the table, picked by
+// taking the peers closest to a random target so that repeated calls tend to
+// surface different parts of the table.
+func (d *Discovery) RandomPeers(n int) []NodeInfo {
+	target := randomId()
+	return d.table.Closest(target.String(), n)
+}
+
+// randomId returns a uniformly random hashedId, suitable as a lookup target
+// when we want to sample an arbitrary part of the table rather than the
+// neighborhood of a specific node id.
+func randomId() hashedId {
+	var id hashedId
+	if _, err := rand.Read(id[:]); err != nil {
+		// crypto/rand.Read on the standard reader only fails if the OS
+		// entropy source is broken, which we can't recover from anyway.
+		panic(fmt.Sprintf("discover: failed to read random bytes: %v", err))
+	}
+	return id
+}
+
+// Table exposes the underlying routing table, e.g. for diagnostics.
+func (d *Discovery) Table() *Table {
+	return d.table
+}
@@ -0,0 +1,71 @@
+// Package discover implements a Kademlia-style peer discovery protocol for
+// p2p2: a k-bucket routing table keyed by node id XOR distance, and a
+// UDP ping/pong/findnode/neighbors wire protocol for populating it against a
+// set of bootnodes.
+package discover
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// idBytes is the length in bytes of a node id's hash used for XOR distance.
+// Node ids themselves are opaque strings (as used by p2p2.RemoteNode) - we
+// hash them down to a fixed-width id for bucketing.
+const idBytes = 32
+
+// hashedId is the fixed-width, uniformly distributed form of a node id used
+// to compute XOR distance and bucket index.
+type hashedId [idBytes]byte
+
+func hashNodeId(id string) hashedId {
+	return sha256.Sum256([]byte(id))
+}
+
+// NodeInfo is everything the discovery protocol and Swarm.Bootstrap need to
+// know about a peer: its id and where to reach it over UDP/TCP.
+type NodeInfo struct {
+	Id   string // node id / public key, same namespace as p2p2.RemoteNode ids
+	Ip   string // host:port the node listens for p2p2 connections on
+	addr hashedId
+}
+
+func NewNodeInfo(id string, ip string) NodeInfo {
+	return NodeInfo{Id: id, Ip: ip, addr: hashNodeId(id)}
+}
+
+// distance returns the XOR distance between two node ids as a big-endian byte array.
+func distance(a, b hashedId) hashedId {
+	var d hashedId
+	for i := range d {
+		d[i] = a[i] ^ b[i]
+	}
+	return d
+}
+
+// bucketIndex returns the index (0..idBytes*8-1) of the k-bucket that b
+// belongs in from a's point of view: idBytes*8-1 minus the number of leading
+// zero bits in the XOR distance between a and b. Identical ids have no valid
+// bucket (-1).
+func bucketIndex(a, b hashedId) int {
+	d := distance(a, b)
+
+	leadingZeros := 0
+	for _, bt := range d {
+		if bt == 0 {
+			leadingZeros += 8
+			continue
+		}
+		for bit := 0; bit < 8; bit++ {
+			if bt&(0x80>>uint(bit)) != 0 {
+				leadingZeros += bit
+				return idBytes*8 - 1 - leadingZeros
+			}
+		}
+	}
+	return -1
+}
+
+func (h hashedId) String() string {
+	return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,321 @@
+package discover
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/UnrulyOS/go-unruly/log"
+)
+
+// packetTimeout bounds how long we wait for a pong or neighbors reply to a
+// single UDP request before giving up on that peer.
+const packetTimeout = 5 * time.Second
+
+// alpha is the lookup concurrency factor - the number of closest-so-far
+// nodes queried in parallel on each round of an iterative lookup.
+const alpha = 3
+
+type packetType byte
+
+const (
+	pingPacket packetType = iota + 1
+	pongPacket
+	findNodePacket
+	neighborsPacket
+)
+
+// packet is the wire envelope for every discovery message. body is the
+// gob-encoded form of one of the payload types below.
+type packet struct {
+	Type   packetType
+	FromId string
+	Body   []byte
+}
+
+type pingPayload struct{}
+
+type pongPayload struct{}
+
+type findNodePayload struct {
+	Target string
+}
+
+type neighborsPayload struct {
+	Nodes []NodeInfo
+}
+
+// Protocol speaks the UDP ping/pong/findnode/neighbors wire protocol and
+// keeps a Table populated with what it learns along the way.
+type Protocol struct {
+	localId string
+	table   *Table
+	conn    *net.UDPConn
+
+	onDiscovered func(NodeInfo) // called whenever a new node is learned about
+
+	mu      sync.Mutex
+	pending map[string]chan packet // key: remoteAddr+"|"+packetType, closed/delivered once
+
+	kill chan struct{}
+}
+
+// Listen starts a Protocol bound to listenAddr (host:port, udp), backed by
+// table, invoking onDiscovered (if non-nil) whenever a previously unknown
+// node is learned about via ping or neighbors.
+func Listen(localId string, listenAddr string, table *Table, onDiscovered func(NodeInfo)) (*Protocol, error) {
+	addr, err := net.ResolveUDPAddr("udp", listenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("discover: bad listen address: %w", err)
+	}
+
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("discover: can't listen on %s: %w", listenAddr, err)
+	}
+
+	p := &Protocol{
+		localId:      localId,
+		table:        table,
+		conn:         conn,
+		onDiscovered: onDiscovered,
+		pending:      make(map[string]chan packet),
+		kill:         make(chan struct{}),
+	}
+
+	go p.readLoop()
+
+	return p, nil
+}
+
+func (p *Protocol) Close() {
+	close(p.kill)
+	p.conn.Close()
+}
+
+func (p *Protocol) readLoop() {
+	buf := make([]byte, 4096)
+	for {
+		n, from, err := p.conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-p.kill:
+				return
+			default:
+				log.Warning("discover: read error: %v", err)
+				continue
+			}
+		}
+
+		var pkt packet
+		if err := gob.NewDecoder(bytes.NewReader(buf[:n])).Decode(&pkt); err != nil {
+			log.Warning("discover: bad packet from %s: %v", from, err)
+			continue
+		}
+
+		p.handlePacket(from, pkt)
+	}
+}
+
+func (p *Protocol) handlePacket(from *net.UDPAddr, pkt packet) {
+
+	if pkt.FromId != "" && pkt.FromId != p.localId {
+		node := NewNodeInfo(pkt.FromId, from.String())
+
+		closest := p.table.Closest(pkt.FromId, 1)
+		isNew := len(closest) == 0 || closest[0].Id != pkt.FromId
+
+		p.table.Add(node)
+		if isNew && p.onDiscovered != nil {
+			p.onDiscovered(node)
+		}
+	}
+
+	switch pkt.Type {
+	case pingPacket:
+		p.send(from, pongPacket, pongPayload{})
+
+	case findNodePacket:
+		var req findNodePayload
+		decode(pkt.Body, &req)
+		closest := p.table.Closest(req.Target, BucketSize)
+		p.send(from, neighborsPacket, neighborsPayload{Nodes: closest})
+
+	case pongPacket, neighborsPacket:
+		p.deliver(from, pkt)
+	}
+}
+
+func (p *Protocol) deliver(from *net.UDPAddr, pkt packet) {
+	key := waitKey(from.String(), pkt.Type)
+
+	p.mu.Lock()
+	ch, found := p.pending[key]
+	p.mu.Unlock()
+
+	if found {
+		ch <- pkt
+	}
+}
+
+func waitKey(addr string, t packetType) string {
+	return fmt.Sprintf("%s|%d", addr, t)
+}
+
+func (p *Protocol) send(to *net.UDPAddr, t packetType, payload interface{}) error {
+	var body bytes.Buffer
+	if err := gob.NewEncoder(&body).Encode(payload); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	pkt := packet{Type: t, FromId: p.localId, Body: body.Bytes()}
+	if err := gob.NewEncoder(&buf).Encode(pkt); err != nil {
+		return err
+	}
+
+	_, err := p.conn.WriteToUDP(buf.Bytes(), to)
+	return err
+}
+
+func decode(body []byte, out interface{}) {
+	_ = gob.NewDecoder(bytes.NewReader(body)).Decode(out)
+}
+
+// waitFor registers interest in the next packet of type t from addr and
+// blocks until it arrives, ctx is done, or packetTimeout elapses.
+func (p *Protocol) waitFor(ctx context.Context, addr *net.UDPAddr, t packetType) (packet, error) {
+	key := waitKey(addr.String(), t)
+	ch := make(chan packet, 1)
+
+	p.mu.Lock()
+	p.pending[key] = ch
+	p.mu.Unlock()
+
+	defer func() {
+		p.mu.Lock()
+		delete(p.pending, key)
+		p.mu.Unlock()
+	}()
+
+	timeout := time.NewTimer(packetTimeout)
+	defer timeout.Stop()
+
+	select {
+	case pkt := <-ch:
+		return pkt, nil
+	case <-timeout.C:
+		return packet{}, errors.New("discover: timed out waiting for reply")
+	case <-ctx.Done():
+		return packet{}, ctx.Err()
+	}
+}
+
+// Ping sends a ping to addr and waits for a pong.
+func (p *Protocol) Ping(ctx context.Context, addr string) error {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return err
+	}
+
+	if err := p.send(udpAddr, pingPacket, pingPayload{}); err != nil {
+		return err
+	}
+
+	_, err = p.waitFor(ctx, udpAddr, pongPacket)
+	return err
+}
+
+// FindNode asks addr for the nodes closest to target and waits for its
+// neighbors reply.
+func (p *Protocol) FindNode(ctx context.Context, addr string, target string) ([]NodeInfo, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.send(udpAddr, findNodePacket, findNodePayload{Target: target}); err != nil {
+		return nil, err
+	}
+
+	pkt, err := p.waitFor(ctx, udpAddr, neighborsPacket)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp neighborsPayload
+	decode(pkt.Body, &resp)
+	return resp.Nodes, nil
+}
+
+// Lookup runs an iterative Kademlia lookup for target, querying the alpha
+// closest known nodes at each round and folding newly discovered nodes back
+// into the table, until a round turns up nothing closer than what's already
+// known.
+func (p *Protocol) Lookup(ctx context.Context, target string) []NodeInfo {
+
+	queried := make(map[string]bool)
+	closest := p.table.Closest(target, BucketSize)
+
+	for {
+		candidates := 0
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+
+		for _, n := range closest {
+			if queried[n.Id] || candidates >= alpha {
+				continue
+			}
+			queried[n.Id] = true
+			candidates++
+
+			wg.Add(1)
+			go func(n NodeInfo) {
+				defer wg.Done()
+				found, err := p.FindNode(ctx, n.Ip, target)
+				if err != nil {
+					return
+				}
+				mu.Lock()
+				for _, f := range found {
+					known := p.table.Closest(f.Id, 1)
+					isNew := f.Id != "" && f.Id != p.localId && (len(known) == 0 || known[0].Id != f.Id)
+					p.table.Add(f)
+					if isNew && p.onDiscovered != nil {
+						p.onDiscovered(f)
+					}
+				}
+				mu.Unlock()
+			}(n)
+		}
+
+		if candidates == 0 {
+			return closest
+		}
+
+		wg.Wait()
+
+		next := p.table.Closest(target, BucketSize)
+		if sameNodes(closest, next) {
+			return next
+		}
+		closest = next
+	}
+}
+
+func sameNodes(a, b []NodeInfo) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Id != b[i].Id {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,110 @@
+package discover
+
+import (
+	"sort"
+	"sync"
+)
+
+// BucketSize is k, the maximum number of entries held in a single k-bucket.
+// New entries past this limit evict the least-recently-seen one.
+const BucketSize = 16
+
+// NumBuckets is the number of k-buckets in the table, one per possible bit
+// position of the XOR distance to the local id.
+const NumBuckets = idBytes * 8
+
+// Table is a Kademlia-style routing table: NumBuckets k-buckets, each
+// holding up to BucketSize peers at that XOR distance from the local id.
+// Safe for concurrent use - it's shared between the UDP protocol goroutine
+// and lookups issued by Swarm.
+type Table struct {
+	mu      sync.Mutex
+	localId hashedId
+	buckets [NumBuckets][]NodeInfo
+}
+
+// NewTable creates an empty routing table centered on localId.
+func NewTable(localId string) *Table {
+	return &Table{localId: hashNodeId(localId)}
+}
+
+// Add records that node was just seen alive, moving it to the end (most
+// recently seen) of its bucket. If the bucket is full, the least-recently
+// seen entry is evicted in its favor - in a full implementation that entry
+// would be pinged first and kept if it's still alive, but a straight evict
+// keeps this table's first cut simple.
+func (t *Table) Add(node NodeInfo) {
+	if node.Id == "" {
+		return
+	}
+
+	node.addr = hashNodeId(node.Id)
+
+	idx := bucketIndex(t.localId, node.addr)
+	if idx < 0 {
+		// node.Id hashes to the local id - nothing to add
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	bucket := t.buckets[idx]
+	for i, n := range bucket {
+		if n.Id == node.Id {
+			bucket = append(bucket[:i], bucket[i+1:]...)
+			break
+		}
+	}
+
+	bucket = append(bucket, node)
+	if len(bucket) > BucketSize {
+		bucket = bucket[len(bucket)-BucketSize:]
+	}
+
+	t.buckets[idx] = bucket
+}
+
+// Closest returns up to count nodes known to the table, sorted by ascending
+// XOR distance to targetId. Used both to answer findnode requests and to
+// drive iterative lookups.
+func (t *Table) Closest(targetId string, count int) []NodeInfo {
+	target := hashNodeId(targetId)
+
+	t.mu.Lock()
+	all := make([]NodeInfo, 0, BucketSize)
+	for _, bucket := range t.buckets {
+		all = append(all, bucket...)
+	}
+	t.mu.Unlock()
+
+	sort.Slice(all, func(i, j int) bool {
+		return less(distance(target, all[i].addr), distance(target, all[j].addr))
+	})
+
+	if len(all) > count {
+		all = all[:count]
+	}
+	return all
+}
+
+// Size returns the total number of nodes known across all buckets.
+func (t *Table) Size() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	n := 0
+	for _, bucket := range t.buckets {
+		n += len(bucket)
+	}
+	return n
+}
+
+func less(a, b hashedId) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package discover
+
+import (
+	"testing"
+)
+
+func TestDistanceIsSymmetricAndZeroForSelf(t *testing.T) {
+	a := hashNodeId("a")
+	b := hashNodeId("b")
+
+	if distance(a, a) != (hashedId{}) {
+		t.Fatalf("distance(a, a) = %v, want zero", distance(a, a))
+	}
+	if distance(a, b) != distance(b, a) {
+		t.Fatalf("distance(a, b) = %v, distance(b, a) = %v, want equal", distance(a, b), distance(b, a))
+	}
+}
+
+func TestBucketIndexIdenticalIds(t *testing.T) {
+	a := hashNodeId("same")
+	if idx := bucketIndex(a, a); idx != -1 {
+		t.Fatalf("bucketIndex(a, a) = %d, want -1", idx)
+	}
+}
+
+func TestBucketIndexLeadingZeroBits(t *testing.T) {
+	a := hashedId{}
+
+	// differs only in the lowest bit of the last byte - 255 leading zero
+	// bits in the distance, so it belongs in bucket 0.
+	b := hashedId{}
+	b[idBytes-1] = 0x01
+	if idx := bucketIndex(a, b); idx != 0 {
+		t.Fatalf("bucketIndex with 1-bit distance = %d, want 0", idx)
+	}
+
+	// differs in the top bit of the first byte - no leading zero bits, so it
+	// belongs in the last bucket.
+	c := hashedId{}
+	c[0] = 0x80
+	if idx := bucketIndex(a, c); idx != NumBuckets-1 {
+		t.Fatalf("bucketIndex with top-bit distance = %d, want %d", idx, NumBuckets-1)
+	}
+}
+
+func TestTableAddAndClosestOrdersByDistance(t *testing.T) {
+	table := NewTable("local")
+
+	ids := []string{"a", "b", "c", "d", "e"}
+	for _, id := range ids {
+		table.Add(NewNodeInfo(id, "127.0.0.1:0"))
+	}
+
+	if got := table.Size(); got != len(ids) {
+		t.Fatalf("table.Size() = %d, want %d", got, len(ids))
+	}
+
+	target := hashNodeId("local")
+	results := table.Closest("local", len(ids))
+	if len(results) != len(ids) {
+		t.Fatalf("Closest returned %d nodes, want %d", len(results), len(ids))
+	}
+
+	for i := 1; i < len(results); i++ {
+		prev := distance(target, hashNodeId(results[i-1].Id))
+		cur := distance(target, hashNodeId(results[i].Id))
+		if !less(prev, cur) && prev != cur {
+			t.Fatalf("Closest results not sorted by ascending distance at index %d: %v then %v", i, results[i-1].Id, results[i].Id)
+		}
+	}
+}
+
+func TestTableAddUpdatesExistingNodeInsteadOfDuplicating(t *testing.T) {
+	table := NewTable("local")
+
+	table.Add(NewNodeInfo("peer", "127.0.0.1:1"))
+	table.Add(NewNodeInfo("peer", "127.0.0.1:2"))
+
+	if got := table.Size(); got != 1 {
+		t.Fatalf("table.Size() = %d, want 1 (re-adding a known id should not duplicate it)", got)
+	}
+
+	idx := bucketIndex(table.localId, hashNodeId("peer"))
+	bucket := table.buckets[idx]
+	if len(bucket) != 1 || bucket[0].Ip != "127.0.0.1:2" {
+		t.Fatalf("bucket %d = %v, want a single entry with the updated Ip", idx, bucket)
+	}
+}
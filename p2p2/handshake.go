@@ -0,0 +1,324 @@
+package p2p2
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	plog "github.com/UnrulyOS/go-unruly/p2p2/log"
+	"github.com/UnrulyOS/go-unruly/p2p2/pb"
+	"github.com/gogo/protobuf/proto"
+)
+
+var (
+	// ErrSelfConnect is returned by ConnectTo/CreateSession when the remote id
+	// is the local node's own id.
+	ErrSelfConnect = errors.New("p2p2: cannot connect to self")
+
+	// ErrHandshakeSignature is returned when a peer's long-term identity key
+	// doesn't verify the signature over its ephemeral public key.
+	ErrHandshakeSignature = errors.New("p2p2: handshake signature verification failed")
+
+	// ErrHandshakeMAC names the failure of a post-handshake message whose
+	// session id or MAC doesn't match an established session. No function in
+	// this package returns it: onRemoteClientMessage closes the connection
+	// on such a message instead.
+	ErrHandshakeMAC = errors.New("p2p2: message session id or mac mismatch")
+)
+
+// HandshakeProtocol establishes an authenticated, encrypted NetworkSession
+// with a RemoteNode: an ephemeral ECDH exchange signed by each side's
+// long-term identity key, from which symmetric AES-GCM keys are derived.
+type HandshakeProtocol interface {
+
+	// CreateSession runs the initiator role against remote, blocking until a
+	// NetworkSession is established and stored on remote, ctx is done, or the
+	// handshake fails. The swarm dispatches CreateSession on its own
+	// goroutine, off the single-threaded main event loop, so that a slow
+	// dial/handshake doesn't stall unrelated swarm activity (see
+	// swarmImpl.onConnectionRequest) - remote.HasSession/SetSession/GetSession
+	// must therefore be safe to call concurrently with the event loop's own
+	// use of the same RemoteNode (e.g. onRemoteClientMessage reading the
+	// session to decrypt an incoming message).
+	CreateSession(ctx context.Context, remote RemoteNode) error
+
+	// OnHandshakeMessage runs the responder role for a handshake message
+	// received on c. It's invoked by the swarm when an incoming
+	// pb.CommonMessageData arrives with an empty Payload. On success it
+	// returns the authenticated RemoteNode so the caller can register it
+	// (and c) into the swarm's peer/connection bookkeeping - OnHandshakeMessage
+	// itself only ever runs on the swarm's main event loop (it's called
+	// synchronously from onRemoteClientMessage), so it never touches that
+	// bookkeeping directly.
+	OnHandshakeMessage(ctx context.Context, c Connection, data *pb.CommonMessageData) (RemoteNode, error)
+
+	// SetRemoteNodeLookup gives the handshake protocol a way to find a
+	// RemoteNode we already know by node id, so OnHandshakeMessage can
+	// resume/re-use its existing identity and session state instead of
+	// handshaking into a throwaway RemoteNode every time a peer reconnects.
+	// The swarm calls this once, with a lookup backed by its own peers map,
+	// before its event loop starts.
+	SetRemoteNodeLookup(lookup func(nodeId string) (RemoteNode, bool))
+}
+
+type handshakeProtocolImpl struct {
+	localNode    LocalNode
+	lookupRemote func(nodeId string) (RemoteNode, bool)
+}
+
+// NewHandshakeProtocol creates the handshake protocol handler for a local node.
+func NewHandshakeProtocol(l LocalNode) HandshakeProtocol {
+	return &handshakeProtocolImpl{localNode: l}
+}
+
+func (h *handshakeProtocolImpl) SetRemoteNodeLookup(lookup func(nodeId string) (RemoteNode, bool)) {
+	h.lookupRemote = lookup
+}
+
+// resumableSession reports whether remote already has a fully authenticated
+// session we can keep using rather than renegotiating.
+func resumableSession(remote RemoteNode) bool {
+	if !remote.HasSession() {
+		return false
+	}
+	var resumable bool
+	remote.GetSession(func(s NetworkSession) {
+		resumable = s.IsAuthenticated()
+	})
+	return resumable
+}
+
+func (h *handshakeProtocolImpl) CreateSession(ctx context.Context, remote RemoteNode) error {
+
+	l := plog.New(plog.Peer(remote.Id()), plog.Proto("handshake"), plog.Dir(plog.DirOut))
+
+	if remote.Id() == h.localNode.Id() {
+		return ErrSelfConnect
+	}
+
+	// reconnecting to a node we have a session history with - try to resume
+	// rather than paying for a full ECDH exchange again.
+	if resumableSession(remote) {
+		return nil
+	}
+
+	curve := ecdh.P256()
+
+	ephemeralKey, err := curve.GenerateKey(rand.Reader)
+	if err != nil {
+		return fmt.Errorf("p2p2: failed to generate ephemeral key: %w", err)
+	}
+
+	ephemeralPub := ephemeralKey.PublicKey().Bytes()
+
+	sig, err := h.localNode.PrivateKey().Sign(ephemeralPub)
+	if err != nil {
+		return fmt.Errorf("p2p2: failed to sign handshake syn: %w", err)
+	}
+
+	synMsg := &pb.CommonMessageData{
+		HandshakeData: &pb.HandshakeData{
+			NodeId:       h.localNode.Id(),
+			EphemeralKey: ephemeralPub,
+			Signature:    sig,
+		},
+	}
+
+	data, err := proto.Marshal(synMsg)
+	if err != nil {
+		return err
+	}
+
+	respData, err := remote.SendHandshakeMessage(ctx, data)
+	if err != nil {
+		return fmt.Errorf("p2p2: handshake send failed: %w", err)
+	}
+
+	ackMsg := &pb.CommonMessageData{}
+	if err := proto.Unmarshal(respData, ackMsg); err != nil {
+		return fmt.Errorf("p2p2: bad handshake ack: %w", err)
+	}
+
+	ack := ackMsg.HandshakeData
+	if ack == nil {
+		return errors.New("p2p2: handshake ack missing handshake data")
+	}
+
+	remotePub, err := remote.PublicKey().Verify(ack.EphemeralKey, ack.Signature)
+	if err != nil || !remotePub {
+		return ErrHandshakeSignature
+	}
+
+	session, err := deriveSession(curve, ephemeralKey, ack.EphemeralKey, h.localNode.Id(), remote.Id(), true)
+	if err != nil {
+		return err
+	}
+
+	remote.SetSession(session)
+	plog.DefaultMetrics.IncSessionsEstablished()
+
+	l.With(plog.Conn(session.Id())).Info("established session")
+
+	return nil
+}
+
+func (h *handshakeProtocolImpl) OnHandshakeMessage(ctx context.Context, c Connection, data *pb.CommonMessageData) (RemoteNode, error) {
+
+	l := plog.New(plog.Conn(c.Id()), plog.Proto("handshake"), plog.Dir(plog.DirIn))
+
+	syn := data.HandshakeData
+	if syn == nil {
+		return nil, errors.New("p2p2: handshake message missing handshake data")
+	}
+
+	// reuse the RemoteNode we already track for this peer, if any, so its
+	// identity survives across reconnects rather than being replaced by a
+	// disposable node the caller can't look up again. A peer only sends us a
+	// SYN when it doesn't consider its own side resumable, so we still
+	// negotiate a fresh session below either way, replacing any existing one -
+	// what the lookup saves us here is the throwaway object.
+	remote, existing := h.lookupExisting(syn.NodeId)
+	if !existing {
+		var err error
+		remote, err = NewRemoteNode(syn.NodeId, c.RemoteAddr())
+		if err != nil {
+			return nil, err
+		}
+	} else if resumableSession(remote) {
+		l.With(plog.Peer(remote.Id())).Info("renegotiating session for a peer with a still-resumable one")
+	}
+
+	verified, err := remote.PublicKey().Verify(syn.EphemeralKey, syn.Signature)
+	if err != nil || !verified {
+		l.With(plog.Peer(remote.Id())).Warning("handshake signature verification failed: %v", err)
+		c.Close()
+		return nil, ErrHandshakeSignature
+	}
+
+	curve := ecdh.P256()
+
+	ephemeralKey, err := curve.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	sig, err := h.localNode.PrivateKey().Sign(ephemeralKey.PublicKey().Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	ackMsg := &pb.CommonMessageData{
+		HandshakeData: &pb.HandshakeData{
+			NodeId:       h.localNode.Id(),
+			EphemeralKey: ephemeralKey.PublicKey().Bytes(),
+			Signature:    sig,
+		},
+	}
+
+	ackData, err := proto.Marshal(ackMsg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.Send(ackData); err != nil {
+		return nil, err
+	}
+
+	session, err := deriveSession(curve, ephemeralKey, syn.EphemeralKey, h.localNode.Id(), remote.Id(), false)
+	if err != nil {
+		return nil, err
+	}
+
+	remote.SetSession(session)
+	plog.DefaultMetrics.IncSessionsEstablished()
+
+	l.With(plog.Peer(remote.Id())).Info("accepted session")
+
+	return remote, nil
+}
+
+// lookupExisting returns the RemoteNode already known for nodeId, if the
+// swarm has wired up a lookup via SetRemoteNodeLookup.
+func (h *handshakeProtocolImpl) lookupExisting(nodeId string) (RemoteNode, bool) {
+	if h.lookupRemote == nil {
+		return nil, false
+	}
+	return h.lookupRemote(nodeId)
+}
+
+// initiatorToResponderLabel and responderToInitiatorLabel name the two
+// directions a session's keys are expanded for, so each direction gets its
+// own AES-GCM key instead of reusing one symmetric key (which is naturally
+// identical on both ends for an ECDH shared secret) to seal traffic in both
+// directions under the same nonce space.
+var (
+	initiatorToResponderLabel = []byte("p2p2 handshake initiator->responder")
+	responderToInitiatorLabel = []byte("p2p2 handshake responder->initiator")
+)
+
+// deriveSession computes the ECDH shared secret, expands it into a pair of
+// directional AES-256 keys and builds the session id from both ephemeral
+// public keys so everything agrees on both ends regardless of which side
+// initiated.
+func deriveSession(curve ecdh.Curve, local *ecdh.PrivateKey, remotePub []byte, localNodeId, remoteNodeId string, isInitiator bool) (*networkSession, error) {
+
+	peer, err := curve.NewPublicKey(remotePub)
+	if err != nil {
+		return nil, fmt.Errorf("p2p2: invalid remote ephemeral key: %w", err)
+	}
+
+	shared, err := local.ECDH(peer)
+	if err != nil {
+		return nil, fmt.Errorf("p2p2: ecdh failed: %w", err)
+	}
+
+	prk := sha256.Sum256(shared)
+	initToResp := expandKey(prk[:], initiatorToResponderLabel)
+	respToInit := expandKey(prk[:], responderToInitiatorLabel)
+
+	sendKey, recvKey := respToInit, initToResp
+	if isInitiator {
+		sendKey, recvKey = initToResp, respToInit
+	}
+
+	localEphPub := local.PublicKey().Bytes()
+
+	idHash := sha256.New()
+	// sort so both sides derive the same session id regardless of role
+	if localNodeId < remoteNodeId {
+		idHash.Write([]byte(localNodeId))
+		idHash.Write([]byte(remoteNodeId))
+	} else {
+		idHash.Write([]byte(remoteNodeId))
+		idHash.Write([]byte(localNodeId))
+	}
+	// also sort the ephemeral keys - unlike the node ids these are freshly
+	// generated per handshake and aren't assigned to a role in a way both
+	// sides agree on, so sorting them is the only way to land on the same
+	// bytes regardless of who initiated.
+	if bytes.Compare(localEphPub, remotePub) < 0 {
+		idHash.Write(localEphPub)
+		idHash.Write(remotePub)
+	} else {
+		idHash.Write(remotePub)
+		idHash.Write(localEphPub)
+	}
+
+	sessionId := fmt.Sprintf("%x", idHash.Sum(nil))[:16]
+
+	return newNetworkSession(sessionId, sendKey, recvKey)
+}
+
+// expandKey derives a 32-byte AES-256 key from prk for a single direction
+// label, HKDF-Expand style: since sha256's output is already the size we
+// need, one HMAC round suffices.
+func expandKey(prk, label []byte) []byte {
+	mac := hmac.New(sha256.New, prk)
+	mac.Write(label)
+	return mac.Sum(nil)
+}
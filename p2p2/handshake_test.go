@@ -0,0 +1,90 @@
+package p2p2
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"testing"
+)
+
+func TestDeriveSessionAgreesOnBothEnds(t *testing.T) {
+	curve := ecdh.P256()
+
+	initiatorKey, err := curve.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	responderKey, err := curve.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+
+	initiatorSession, err := deriveSession(curve, initiatorKey, responderKey.PublicKey().Bytes(), "alice", "bob", true)
+	if err != nil {
+		t.Fatalf("deriveSession(initiator) failed: %v", err)
+	}
+	responderSession, err := deriveSession(curve, responderKey, initiatorKey.PublicKey().Bytes(), "bob", "alice", false)
+	if err != nil {
+		t.Fatalf("deriveSession(responder) failed: %v", err)
+	}
+
+	if initiatorSession.Id() != responderSession.Id() {
+		t.Fatalf("session ids differ: %q vs %q", initiatorSession.Id(), responderSession.Id())
+	}
+
+	sealed, nonce, err := initiatorSession.Encrypt([]byte("hello"))
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+	if _, err := responderSession.Decrypt(nonce, sealed); err != nil {
+		t.Fatalf("responder could not decrypt what initiator sent: %v", err)
+	}
+}
+
+func TestDeriveSessionIdIndependentOfRole(t *testing.T) {
+	curve := ecdh.P256()
+
+	aKey, err := curve.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	bKey, err := curve.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+
+	forward, err := deriveSession(curve, aKey, bKey.PublicKey().Bytes(), "a", "b", true)
+	if err != nil {
+		t.Fatalf("deriveSession failed: %v", err)
+	}
+	backward, err := deriveSession(curve, bKey, aKey.PublicKey().Bytes(), "b", "a", false)
+	if err != nil {
+		t.Fatalf("deriveSession failed: %v", err)
+	}
+
+	if forward.Id() != backward.Id() {
+		t.Fatalf("session id depends on which side computed it: %q vs %q", forward.Id(), backward.Id())
+	}
+}
+
+func TestExpandKeyDifferentLabelsProduceDifferentKeys(t *testing.T) {
+	prk := []byte("shared-secret-placeholder-32byte")
+
+	a := expandKey(prk, initiatorToResponderLabel)
+	b := expandKey(prk, responderToInitiatorLabel)
+
+	if bytes.Equal(a, b) {
+		t.Fatalf("expandKey produced the same key for both directional labels")
+	}
+}
+
+func TestExpandKeyDeterministic(t *testing.T) {
+	prk := []byte("shared-secret-placeholder-32byte")
+
+	a := expandKey(prk, initiatorToResponderLabel)
+	b := expandKey(prk, initiatorToResponderLabel)
+
+	if !bytes.Equal(a, b) {
+		t.Fatalf("expandKey is not deterministic for the same prk/label")
+	}
+}
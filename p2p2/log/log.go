@@ -0,0 +1,77 @@
+// Package log carries structured key/value context - peer, connection,
+// request and protocol ids - through the p2p2 swarm, so a handshake failure
+// or decrypt error can be correlated back to the specific dial or send that
+// caused it.
+package log
+
+import (
+	"fmt"
+	"strings"
+
+	unrulylog "github.com/UnrulyOS/go-unruly/log"
+)
+
+// Direction values for the Dir field.
+const (
+	DirIn  = "in"
+	DirOut = "out"
+)
+
+// Field is one key/value pair of context attached to a Logger.
+type Field struct {
+	Key   string
+	Value string
+}
+
+func Peer(id string) Field    { return Field{"peer", id} }
+func Conn(id string) Field    { return Field{"conn", id} }
+func ReqID(id string) Field   { return Field{"reqID", id} }
+func Proto(name string) Field { return Field{"proto", name} }
+func Dir(dir string) Field    { return Field{"dir", dir} }
+
+// Logger wraps go-unruly's package-level log functions, prefixing every line
+// with its accumulated Fields so context survives across the many places a
+// single connection or request touches the swarm.
+type Logger struct {
+	fields []Field
+}
+
+// New builds a Logger carrying fields. Typically called once per connection
+// or per request, then extended with With as more context becomes available.
+func New(fields ...Field) Logger {
+	return Logger{fields: fields}
+}
+
+// With returns a copy of l with additional fields appended.
+func (l Logger) With(fields ...Field) Logger {
+	next := make([]Field, 0, len(l.fields)+len(fields))
+	next = append(next, l.fields...)
+	next = append(next, fields...)
+	return Logger{fields: next}
+}
+
+func (l Logger) Info(format string, args ...interface{}) {
+	unrulylog.Info(l.prefix()+format, args...)
+}
+
+func (l Logger) Warning(format string, args ...interface{}) {
+	unrulylog.Warning(l.prefix()+format, args...)
+}
+
+func (l Logger) Error(format string, args ...interface{}) {
+	unrulylog.Error(l.prefix()+format, args...)
+}
+
+// prefix renders the accumulated fields as "key=value ..." ahead of the
+// caller's own format string.
+func (l Logger) prefix() string {
+	if len(l.fields) == 0 {
+		return ""
+	}
+
+	parts := make([]string, len(l.fields))
+	for i, f := range l.fields {
+		parts[i] = fmt.Sprintf("%s=%s", f.Key, f.Value)
+	}
+	return strings.Join(parts, " ") + " - "
+}
@@ -0,0 +1,45 @@
+package log
+
+import "testing"
+
+func TestMetricsIncAndSnapshot(t *testing.T) {
+	m := &Metrics{}
+
+	m.IncDialsAttempted()
+	m.IncDialsAttempted()
+	m.IncDialsSucceeded()
+	m.IncDialsFailed()
+	m.IncMessagesSent()
+	m.IncMessagesReceived()
+	m.IncMessagesDecryptFailed()
+	m.IncSessionsEstablished()
+
+	got := m.Snapshot()
+	want := Metrics{
+		DialsAttempted:        2,
+		DialsSucceeded:        1,
+		DialsFailed:           1,
+		MessagesSent:          1,
+		MessagesReceived:      1,
+		MessagesDecryptFailed: 1,
+		SessionsEstablished:   1,
+	}
+	if got != want {
+		t.Fatalf("Snapshot() = %+v, want %+v", got, want)
+	}
+}
+
+func TestMetricsSnapshotIsIndependentCopy(t *testing.T) {
+	m := &Metrics{}
+	m.IncDialsAttempted()
+
+	snap := m.Snapshot()
+	m.IncDialsAttempted()
+
+	if snap.DialsAttempted != 1 {
+		t.Fatalf("snapshot mutated after being taken: %+v", snap)
+	}
+	if m.Snapshot().DialsAttempted != 2 {
+		t.Fatalf("live counter did not advance after snapshot: %+v", m.Snapshot())
+	}
+}
@@ -1,7 +1,13 @@
 package p2p2
 
 import (
+	"context"
+	"fmt"
+	"time"
+
 	"github.com/UnrulyOS/go-unruly/log"
+	"github.com/UnrulyOS/go-unruly/p2p2/discover"
+	plog "github.com/UnrulyOS/go-unruly/p2p2/log"
 	"github.com/UnrulyOS/go-unruly/p2p2/pb"
 	"github.com/gogo/protobuf/proto"
 )
@@ -27,18 +33,47 @@ import (
 //	- tcp for now
 //  - utp / upd soon
 
+// Suggested deadlines callers should attach to the contexts they pass in -
+// Swarm itself doesn't enforce a particular value, it just stops working on
+// a request as soon as its context is done.
+const (
+	// DefaultDialTimeout bounds dial + DHT lookup + handshake for ConnectTo.
+	DefaultDialTimeout = 10 * time.Minute
+
+	// DefaultSendTimeout bounds how long a SendMessage request waits for a reply.
+	DefaultSendTimeout = 5 * time.Minute
+)
+
+// Response is delivered on the channel returned by Swarm.SendMessage once a
+// matching reply arrives, the request's context is done, or the send fails.
+type Response struct {
+	Msg []byte
+	Err error
+}
+
 type Swarm interface {
 
-	// Attempt to establish a session with a remote node - useful for bootstraping
-	ConnectTo(req NodeReq)
+	// ConnectTo attempts to establish a session with a remote node - useful for bootstraping.
+	// It blocks until a session is ready, ctx is done or the swarm is shutting down.
+	ConnectTo(ctx context.Context, remoteNodeId string, remoteNodeIp string) error
+
+	// DisconnectFrom hands a disconnect request for a node to the swarm's event loop and
+	// returns nil once it has been handled. It does not close the node's connections or session.
+	DisconnectFrom(ctx context.Context, remoteNodeId string) error
 
-	// ConnectToNodes(maxNodes int) Get random nodes (max int) get up to max random nodes from the swarm
+	// SendMessage registers msg as a pending request under reqId. It does not write msg to
+	// any connection, and does not dial or establish a session. The returned channel receives
+	// exactly one Response - either a reply keyed by reqId, or an error once ctx is done.
+	SendMessage(ctx context.Context, remoteNodeId string, reqId string, msg []byte) (<-chan Response, error)
 
-	// forcefully disconnect form a node
-	DisconnectFrom(req NodeReq)
+	// Bootstrap seeds the swarm's peer discovery table from bootnodes and runs
+	// a lookup for our own id, so a fresh node has peers to pick from.
+	Bootstrap(ctx context.Context, bootnodes []discover.NodeInfo) error
 
-	// Send a message to a remote node
-	SendMessage(req SendMessageReq)
+	// ConnectToRandomPeers asks discovery for up to n peers it already knows
+	// about and attempts to connect to each of them, logging (but not
+	// failing on) individual connection errors.
+	ConnectToRandomPeers(n int)
 
 	// todo: Register muxer to handle incoming messages to higher level protocols and handshake protocol
 
@@ -47,22 +82,28 @@ type Swarm interface {
 	LocalNode() LocalNode
 }
 
-type SendMessageReq struct {
-	remoteNodeId string // string encoded key
-	reqId        string
-	msg          []byte
+// connectionRequest is the internal, context-carrying form of a ConnectTo call.
+type connectionRequest struct {
+	ctx          context.Context
+	remoteNodeId string
+	remoteNodeIp string
+	done         chan error
 }
 
-// client node conn req data
-type NodeReq struct {
+// disconnectionRequest is the internal, context-carrying form of a DisconnectFrom call.
+type disconnectionRequest struct {
+	ctx          context.Context
 	remoteNodeId string
-	remoteNodeIp string
-	callback     chan NodeResp
+	done         chan error
 }
 
-type NodeResp struct {
+// sendMessageRequest is the internal, context-carrying form of a SendMessage call.
+type sendMessageRequest struct {
+	ctx          context.Context
 	remoteNodeId string
-	err          error
+	reqId        string
+	msg          []byte
+	respCh       chan Response
 }
 
 type swarmImpl struct {
@@ -71,26 +112,50 @@ type swarmImpl struct {
 	network   Network
 	localNode LocalNode
 	demuxer   Demuxer
+	discovery *discover.Discovery
 
 	// all data should only be accessed from methods executed by the main swarm event loop
 
-	// Internal state not thread safe state - must be access only from methods dispatched from the internal event handler
+	// Internal state not thread safe state - must be access only from methods dispatched from the internal event handler.
+	// The map itself follows that rule, but a RemoteNode's own session accessors
+	// (HasSession/SetSession/GetSession) are called from both the event loop and
+	// the goroutine CreateSession runs on (see HandshakeProtocol.CreateSession),
+	// so those specific methods must be safe for concurrent use.
 	peers             map[string]RemoteNode // remote known nodes mapped by their ids (keys) - Swarm is a peer store. NodeId -> RemoteNode
 	connections       map[string]Connection // all open connections to nodes by conn id. ConnId -> Con.
 	peersByConnection map[string]RemoteNode // remote nodes indexed by their connections. ConnId -> RemoteNode
 
-	pendingOutgoingMessages map[string]SendMessageReq // all messages we don't have a response for yet. k - reqId
+	pendingOutgoingMessages map[string]sendMessageRequest // all requests we don't have a response for yet, keyed by reqId
+
+	// inFlightHandshakes tracks remoteNodeIds that already have a
+	// CreateSession goroutine running against them (see onConnectionRequest).
+	// A second ConnectTo for the same peer while one is in flight is queued
+	// here instead of starting a concurrent handshake, so at most one
+	// goroutine ever calls RemoteNode.SetSession for a given peer at a time.
+	inFlightHandshakes map[string][]chan error
 
 	// add registered callbacks in a sync.map to return to the muxer responses to outgoing messages
 
 	// comm channels
-	connectionRequests chan NodeReq        // request to establish a session w a remote node
-	disconnectRequests chan NodeReq        // kill session and disconnect from node
-	sendMsgRequests    chan SendMessageReq // send a message to a node and callback on error or data
-	kill               chan bool           // used to kill the swamp from outside. e.g when local node is shutting down
+	connectionRequests chan connectionRequest    // request to establish a session w a remote node
+	disconnectRequests chan disconnectionRequest // kill session and disconnect from node
+	sendMsgRequests    chan sendMessageRequest   // send a message to a node and callback on error or data
+	cancelledRequests  chan string               // reqIds whose context was cancelled/timed out - cleans up pendingOutgoingMessages
+	handshakeResults   chan handshakeResult      // results of CreateSession goroutines dispatched by onConnectionRequest
+	kill               chan bool                 // used to kill the swamp from outside. e.g when local node is shutting down
 
 }
 
+// handshakeResult is how a CreateSession goroutine dispatched by
+// onConnectionRequest reports back to the main event loop, so that notifying
+// callers, clearing inFlightHandshakes and registering the connection in
+// peersByConnection all stay single-threaded.
+type handshakeResult struct {
+	remoteNodeId string
+	connId       string // connection the session was established over, if any
+	err          error
+}
+
 func NewSwarm(tcpAddress string, l LocalNode) (Swarm, error) {
 
 	n, err := NewNetwork(tcpAddress)
@@ -106,24 +171,113 @@ func NewSwarm(tcpAddress string, l LocalNode) (Swarm, error) {
 		peersByConnection:       make(map[string]RemoteNode),
 		peers:                   make(map[string]RemoteNode),
 		connections:             make(map[string]Connection),
-		pendingOutgoingMessages: make(map[string]SendMessageReq),
-		connectionRequests:      make(chan NodeReq, 10),
-		disconnectRequests:      make(chan NodeReq, 10),
-		sendMsgRequests:         make(chan SendMessageReq, 20),
+		pendingOutgoingMessages: make(map[string]sendMessageRequest),
+		connectionRequests:      make(chan connectionRequest, 10),
+		disconnectRequests:      make(chan disconnectionRequest, 10),
+		sendMsgRequests:         make(chan sendMessageRequest, 20),
+		cancelledRequests:       make(chan string, 20),
+		handshakeResults:        make(chan handshakeResult, 10),
+		inFlightHandshakes:      make(map[string][]chan error),
 		demuxer:                 NewDemuxer(),
 	}
 
+	// OnHandshakeMessage resolves known peers through this lookup instead of
+	// always handshaking into a throwaway RemoteNode. It's only ever called
+	// from the event loop (OnHandshakeMessage is invoked synchronously from
+	// onRemoteClientMessage), and it's set here before beginProcessingEvents
+	// starts, so reading s.peers through it is safe without a lock.
+	l.HandshakeProtocol().SetRemoteNodeLookup(func(nodeId string) (RemoteNode, bool) {
+		r, ok := s.peers[nodeId]
+		return r, ok
+	})
+
+	d, err := discover.New(l.Id(), tcpAddress, s.onPeerDiscovered)
+	if err != nil {
+		log.Error("can't create swarm without discovery: %v", err)
+		return nil, err
+	}
+	s.discovery = d
+
 	go s.beginProcessingEvents()
 
 	return s, err
 }
 
-func (s *swarmImpl) ConnectTo(req NodeReq) {
-	s.connectionRequests <- req
+// onPeerDiscovered is called by the discovery subsystem, off the main event
+// loop, whenever it learns about a node we didn't already know about. It just
+// logs for now - ConnectToRandomPeers is how discovered peers turn into
+// actual sessions.
+func (s *swarmImpl) onPeerDiscovered(node discover.NodeInfo) {
+	log.Info("discovered new peer %s at %s", node.Id, node.Ip)
 }
 
-func (s *swarmImpl) DisconnectFrom(req NodeReq) {
-	s.disconnectRequests <- req
+// Bootstrap seeds peer discovery from bootnodes so a fresh node has peers to
+// pick from via ConnectToRandomPeers.
+func (s *swarmImpl) Bootstrap(ctx context.Context, bootnodes []discover.NodeInfo) error {
+	return s.discovery.Bootstrap(ctx, s.localNode.Id(), bootnodes)
+}
+
+// ConnectToRandomPeers asks discovery for up to n known peers and dials each
+// of them with a background context bounded by DefaultDialTimeout, logging
+// (rather than failing on) individual connection errors.
+func (s *swarmImpl) ConnectToRandomPeers(n int) {
+	for _, peer := range s.discovery.RandomPeers(n) {
+		go func(peer discover.NodeInfo) {
+			ctx, cancel := context.WithTimeout(context.Background(), DefaultDialTimeout)
+			defer cancel()
+
+			if err := s.ConnectTo(ctx, peer.Id, peer.Ip); err != nil {
+				log.Warning("failed to connect to discovered peer %s: %v", peer.Id, err)
+			}
+		}(peer)
+	}
+}
+
+func (s *swarmImpl) ConnectTo(ctx context.Context, remoteNodeId string, remoteNodeIp string) error {
+	req := connectionRequest{
+		ctx:          ctx,
+		remoteNodeId: remoteNodeId,
+		remoteNodeIp: remoteNodeIp,
+		done:         make(chan error, 1),
+	}
+
+	select {
+	case s.connectionRequests <- req:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-s.kill:
+		return fmt.Errorf("p2p2: swarm is shutting down")
+	}
+
+	select {
+	case err := <-req.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-s.kill:
+		return fmt.Errorf("p2p2: swarm is shutting down")
+	}
+}
+
+func (s *swarmImpl) DisconnectFrom(ctx context.Context, remoteNodeId string) error {
+	req := disconnectionRequest{
+		ctx:          ctx,
+		remoteNodeId: remoteNodeId,
+		done:         make(chan error, 1),
+	}
+
+	select {
+	case s.disconnectRequests <- req:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-req.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func (s *swarmImpl) GetDemuxer() Demuxer {
@@ -134,15 +288,44 @@ func (s *swarmImpl) LocalNode() LocalNode {
 	return s.localNode
 }
 
-// Send a message to a remote node
-// Swarm will establish session if needed or use an existing session and open connection
-// Designed to be used by any high level protocol
-// req.reqId: globally unique id string - used for tracking messages we didn't get a response for yet
-// req.msg: marshaled message data
-// req.destId: receiver remote node public key/id
+// SendMessage registers a message for a remote node as pending until a reply arrives.
+// The message is not written to a connection, and no session or connection is opened for it.
+// Designed to be used by any high level protocol.
+// reqId: globally unique id string - used for tracking messages we didn't get a response for yet
+// msg: marshaled message data
+// remoteNodeId: receiver remote node public key/id
+//
+// The context bounds how long the request stays pending. Once ctx is done the pending entry is removed and a Response carrying ctx.Err() is
+// delivered on the returned channel.
+func (s *swarmImpl) SendMessage(ctx context.Context, remoteNodeId string, reqId string, msg []byte) (<-chan Response, error) {
+	req := sendMessageRequest{
+		ctx:          ctx,
+		remoteNodeId: remoteNodeId,
+		reqId:        reqId,
+		msg:          msg,
+		respCh:       make(chan Response, 1),
+	}
+
+	select {
+	case s.sendMsgRequests <- req:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
 
-func (s *swarmImpl) SendMessage(req SendMessageReq) {
-	s.sendMsgRequests <- req
+	go s.watchForCancellation(ctx, reqId)
+
+	return req.respCh, nil
+}
+
+// watchForCancellation waits for reqId's context to end and notifies the main
+// event loop so it can stop waiting for a response and free pendingOutgoingMessages.
+// Safe to call from any goroutine - only touches channels, never swarmImpl state directly.
+func (s *swarmImpl) watchForCancellation(ctx context.Context, reqId string) {
+	<-ctx.Done()
+	select {
+	case s.cancelledRequests <- reqId:
+	case <-s.kill:
+	}
 }
 
 // Swarm serial event processing
@@ -178,23 +361,43 @@ Loop:
 		case n := <-s.connectionRequests:
 			s.onConnectionRequest(n)
 
+		case r := <-s.handshakeResults:
+			s.onHandshakeResult(r)
+
 		case n := <-s.disconnectRequests:
 			s.onDisconnectionRequest(n)
+
+		case reqId := <-s.cancelledRequests:
+			s.onRequestCancelled(reqId)
 		}
 	}
 }
 
 // connect to node or ensure we are connected
 // start a session on demand if needed
-func (s *swarmImpl) onConnectionRequest(req NodeReq) {
+func (s *swarmImpl) onConnectionRequest(req connectionRequest) {
+
+	l := plog.New(plog.Peer(req.remoteNodeId), plog.Dir(plog.DirOut))
+
+	if req.ctx.Err() != nil {
+		req.done <- req.ctx.Err()
+		return
+	}
+
+	if req.remoteNodeId == s.localNode.Id() {
+		req.done <- ErrSelfConnect
+		return
+	}
 
 	// check for existing session
 	remoteNode := s.peers[req.remoteNodeId]
 
 	if remoteNode == nil {
 
-		remoteNode, err := NewRemoteNode(req.remoteNodeId, req.remoteNodeIp)
+		var err error
+		remoteNode, err = NewRemoteNode(req.remoteNodeId, req.remoteNodeIp)
 		if err != nil {
+			req.done <- err
 			return
 		}
 
@@ -202,38 +405,116 @@ func (s *swarmImpl) onConnectionRequest(req NodeReq) {
 		s.peers[req.remoteNodeId] = remoteNode
 	}
 
-	if remoteNode != nil && remoteNode.HasSession() {
-		log.Info("We have a session with this node")
-
-		remoteNode.GetSession(func(s NetworkSession) {
-			log.Info("Session info: %s", s.IsAuthenticated())
-		})
+	if remoteNode.HasSession() {
+		l.Info("We have a session with this node")
+		req.done <- nil
+		return
+	}
 
+	// a handshake against this peer is already running - queue behind it
+	// instead of starting a second CreateSession goroutine that would race
+	// the first to call SetSession on the same RemoteNode.
+	if waiters, inFlight := s.inFlightHandshakes[req.remoteNodeId]; inFlight {
+		s.inFlightHandshakes[req.remoteNodeId] = append(waiters, req.done)
 		return
 	}
+	s.inFlightHandshakes[req.remoteNodeId] = []chan error{req.done}
+
+	plog.DefaultMetrics.IncDialsAttempted()
+
+	// start handshake protocol - bounded by req.ctx so a stuck dial/handshake
+	// doesn't outlive the caller's deadline. CreateSession calls
+	// remote.SetSession itself once it succeeds, off the main event loop;
+	// inFlightHandshakes above guarantees at most one such goroutine runs
+	// per remote node at a time, so concurrent SetSession calls for the
+	// same RemoteNode can't happen. The goroutine only reports its result
+	// back to the event loop over handshakeResults.
+	go func() {
+		err := s.localNode.HandshakeProtocol().CreateSession(req.ctx, remoteNode)
+		if err != nil {
+			l.Warning("dial/handshake failed: %v", err)
+		}
+
+		// ConnectionId is a pure lookup of which connection remoteNode used
+		// for the handshake - safe to call concurrently with the event loop
+		// for the same reason HasSession/GetSession are (see HandshakeProtocol
+		// doc comment). The event loop is the one that actually records it
+		// in peersByConnection, in onHandshakeResult below.
+		var connId string
+		if err == nil {
+			connId = remoteNode.ConnectionId()
+		}
+
+		s.handshakeResults <- handshakeResult{remoteNodeId: req.remoteNodeId, connId: connId, err: err}
+	}()
+}
+
+// onHandshakeResult runs on the main event loop once a CreateSession
+// goroutine dispatched by onConnectionRequest finishes. It updates dial
+// metrics, registers the connection the session was established over (so
+// onRemoteClientMessage can find this peer's RemoteNode for later encrypted
+// messages on it), and notifies every ConnectTo call that was waiting on
+// this peer's handshake, in the order they queued.
+func (s *swarmImpl) onHandshakeResult(r handshakeResult) {
+	if r.err != nil {
+		plog.DefaultMetrics.IncDialsFailed()
+	} else {
+		plog.DefaultMetrics.IncDialsSucceeded()
+		if r.connId != "" {
+			if remoteNode, ok := s.peers[r.remoteNodeId]; ok {
+				s.peersByConnection[r.connId] = remoteNode
+			}
+		}
+	}
 
-	// start handshake protocol
-	s.localNode.HandshakeProtocol().CreateSession(remoteNode)
+	waiters := s.inFlightHandshakes[r.remoteNodeId]
+	delete(s.inFlightHandshakes, r.remoteNodeId)
+
+	for _, done := range waiters {
+		done <- r.err
+	}
 }
 
-func (s *swarmImpl) onDisconnectionRequest(req NodeReq) {
+func (s *swarmImpl) onDisconnectionRequest(req disconnectionRequest) {
 	// disconnect from node...
+	req.done <- nil
 }
 
+func (s *swarmImpl) onSendMessageRequest(r sendMessageRequest) {
 
-func (s *swarmImpl) onSendMessageRequest(r SendMessageReq) {
+	l := plog.New(plog.Peer(r.remoteNodeId), plog.ReqID(r.reqId), plog.Dir(plog.DirOut))
+
+	if r.ctx.Err() != nil {
+		r.respCh <- Response{Err: r.ctx.Err()}
+		return
+	}
 
 	// check for existing session
 	//remoteNode := s.peers[r.remoteNodeId]
 
-
 	// todo: send message here - establish a connection and session on-demand as needed
 	// todo: auto support for retries
+	// todo: plog.DefaultMetrics.IncMessagesSent() once the message is actually written to a connection
+
+	l.Info("message queued for send")
 
 	// req ids are unique - store as pending until we get a response, error or timeout
 	s.pendingOutgoingMessages[r.reqId] = r
 }
 
+// onRequestCancelled removes a pending outgoing message once its caller's
+// context is done, so pendingOutgoingMessages doesn't leak entries for
+// requests nobody is waiting on any more.
+func (s *swarmImpl) onRequestCancelled(reqId string) {
+	r, found := s.pendingOutgoingMessages[reqId]
+	if !found {
+		return
+	}
+
+	delete(s.pendingOutgoingMessages, reqId)
+	r.respCh <- Response{Err: r.ctx.Err()}
+}
+
 func (s *swarmImpl) onConnectionClosed(c Connection) {
 	delete(s.connections, c.Id())
 	delete(s.peersByConnection, c.Id())
@@ -251,62 +532,102 @@ func (s *swarmImpl) onRemoteClientMessage(msg ConnectionMessage) {
 
 	// Processing a remote incoming message:
 
+	l := plog.New(plog.Conn(msg.Connection.Id()), plog.Dir(plog.DirIn))
+
 	c := &pb.CommonMessageData{}
 	err := proto.Unmarshal(msg.Message, c)
 	if err != nil {
-		log.Warning("Bad request - closing connection...")
+		l.Warning("Bad request - closing connection...")
 		msg.Connection.Close()
 		return
 	}
 
 	if len(c.Payload) == 0 {
-		// this a handshake protocol message
-		// send to muxer (protocol, msg, etc....) - protocol handler will create remote node, session, etc...
-	} else {
+		// this is a handshake protocol message - responder role
+		l = l.With(plog.Proto("handshake"))
+		remoteNode, err := s.localNode.HandshakeProtocol().OnHandshakeMessage(context.Background(), msg.Connection, c)
+		if err != nil {
+			l.Warning("handshake failed - closing connection: %v", err)
+			msg.Connection.Close()
+			return
+		}
 
-		// A session encrypted protocol message is in payload
+		// register the now-authenticated peer so later encrypted messages
+		// on this connection can be matched back to it below.
+		s.peers[remoteNode.Id()] = remoteNode
+		s.peersByConnection[msg.Connection.Id()] = remoteNode
+		s.connections[msg.Connection.Id()] = msg.Connection
+		return
+	}
 
-		// 1. find remote node - bail if we can't find it - it should be created on session start
+	// A session encrypted protocol message is in payload
 
-		// 2. get session from remote node - if session not found close the connection
+	// 1. find remote node - bail if we can't find it - it should be created on session start
+	remoteNode, found := s.peersByConnection[msg.Connection.Id()]
+	if !found {
+		l.Warning("message from unknown remote node - closing connection")
+		msg.Connection.Close()
+		return
+	}
 
-		// attempt to decrypt message (c.payload) with active session key
+	l = l.With(plog.Peer(remoteNode.Id()), plog.ReqID(c.ReqId))
 
-		// create pb.ProtocolMessage from the decrypted message
+	// 2. get session from remote node - if session not found close the connection
+	var session NetworkSession
+	remoteNode.GetSession(func(sess NetworkSession) {
+		session = sess
+	})
 
-		// send to muxer pb.protocolMessage to the muxer for handling - it has protocol, reqId, sessionId, etc....
+	if session == nil || !session.IsAuthenticated() || session.Id() != c.SessionId {
+		l.Warning("message with unknown or mismatched session id - closing connection")
+		msg.Connection.Close()
+		return
 	}
 
-	//data := proto.Unmarshal(msg.Message, proto.Message)
-
-	// 1. decyrpt protobuf to a generic protobuf obj - all messages are protobufs but we don't know struct type just yet
-
-	// there are 2 types of high-level payloads: session establishment handshake (req or resp)
-	// and messages encrypted using session id
+	// attempt to decrypt message (c.payload) with active session key - rejects replayed/bad-MAC messages
+	plain, err := session.Decrypt(c.Nonce, c.Payload)
+	if err != nil {
+		plog.DefaultMetrics.IncMessagesDecryptFailed()
+		l.Warning("message failed to decrypt/authenticate - closing connection: %v", err)
+		msg.Connection.Close()
+		return
+	}
 
-	// 2. if session id is included in message and connection has this key then use it to decrypt payload - other reject and close conn
+	// create pb.ProtocolMessage from the decrypted message
+	protoMsg := &pb.ProtocolMessage{}
+	if err := proto.Unmarshal(plain, protoMsg); err != nil {
+		l.Warning("bad protocol message after decryption - closing connection: %v", err)
+		msg.Connection.Close()
+		return
+	}
 
-	// 3. if req is a handshake request or response then handle it to establish a session - use code here or use handshake protocol handler
+	plog.DefaultMetrics.IncMessagesReceived()
 
-	// 4. if req is from a remote node we don't know about so create it
+	l = l.With(plog.Proto(protoMsg.Metadata.Protocol))
+	l.Info("routing message to demuxer")
 
-	// 5. save connection for this remote node - one connection per node for now
+	// send to muxer pb.protocolMessage to the muxer for handling - it has protocol, reqId, sessionId, etc....
+	s.demuxer.RouteIncomingMessage(remoteNode, protoMsg)
 
-	// 6. auth message sent by remote node pub key close connection otherwise
+	reqId := fmt.Sprintf("%s", protoMsg.Metadata.ReqId)
+	if pending, found := s.pendingOutgoingMessages[reqId]; found {
+		delete(s.pendingOutgoingMessages, reqId)
+		pending.respCh <- Response{Msg: plain}
+	}
 
-	// Locate callback a pendingOutgoingMessages for the req id then push the resp over the embedded channel callback to notify caller
-	// of the response data - muxer will forward it to handlers and handler can create struct from buff based on expected typed data
 }
 
 // not go safe - called from event processing main loop
 func (s *swarmImpl) onConnectionError(err ConnectionError) {
+	l := plog.New(plog.Conn(err.Connection.Id()))
+	l.Warning("connection error: %v", err.Err)
 	// close the connection?
 	// who to notify?
 }
 
 // not go safe - called from event processing main loop
 func (s *swarmImpl) onMessageSendError(err MessageSendError) {
+	l := plog.New(plog.ReqID(err.ReqId))
+	l.Warning("message send error: %v", err.Err)
 	// retry ?
 }
-
-// todo: handshake protocol